@@ -0,0 +1,441 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/term"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/zanloy/ksbuilder/pkg/ksbuilder"
+)
+
+// promptKeyPassword reads a password from the controlling terminal without
+// echoing it, for use when an encrypted private key is found but no
+// --key-password/KSBUILDER_KEY_PASSWORD was supplied.
+func promptKeyPassword() (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.New("private key is encrypted but no --key-password was given and stdin is not a terminal to prompt on")
+	}
+	fmt.Fprint(os.Stderr, "Enter password for encrypted private key: ")
+	pw, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(pw), nil
+}
+
+func newLogger(format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid --log-level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return nil, fmt.Errorf("unknown --log-format %q (expected text or json)", format)
+	}
+	return slog.New(handler), nil
+}
+
+// discoverFiles walks certdirs for files ksbuilder knows how to ingest,
+// descending into subdirectories when recurse is set. Any path that
+// resolves to one of exclude (the keystore's own output paths, so a
+// sidecar --out/--truststore-out living inside a watched --dir doesn't
+// get re-ingested as an input on the next rebuild) is skipped.
+func discoverFiles(certdirs []string, recurse bool, exclude map[string]bool, logger *slog.Logger) ([]string, error) {
+	var certfiles []string
+	for _, dir := range certdirs {
+		if tmppath, err := filepath.Abs(dir); err == nil {
+			dir = tmppath
+		}
+		logger.Info("walking directory", "dir", dir)
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if path != dir {
+					if recurse {
+						logger.Debug("recursing into directory", "dir", path)
+						certdirs = append(certdirs, path)
+					} else {
+						logger.Debug("skipping directory, recurse is disabled", "dir", path)
+						return filepath.SkipDir
+					}
+				}
+				return nil
+			}
+			switch filepath.Ext(path) {
+			case ".crt", ".key", ".pem", ".p12", ".pfx", ".p7b":
+			default:
+				logger.Debug("skipping file, unsupported extension", "path", path)
+				return nil
+			}
+			if abspath, err := filepath.Abs(path); err == nil && exclude[abspath] {
+				logger.Debug("skipping file, it is a configured output path", "path", path)
+				return nil
+			}
+			certfiles = append(certfiles, path)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk %s: %w", dir, err)
+		}
+		logger.Info("completed walk", "dir", dir)
+	}
+	return certfiles, nil
+}
+
+// privkeyPath mirrors pkg/ksbuilder's pem-bundle convention of writing the
+// private key alongside the fullchain as "privkey<ext>" in the same
+// directory, so outputPaths/build's atomic rename can compute it too. A
+// trailing ".tmp" is stripped before deriving the extension so it's kept
+// on the sidecar name instead of swallowing ".pem".
+func privkeyPath(fullchainPath string) string {
+	suffix := ""
+	if stripped := strings.TrimSuffix(fullchainPath, ".tmp"); stripped != fullchainPath {
+		fullchainPath = stripped
+		suffix = ".tmp"
+	}
+	ext := filepath.Ext(fullchainPath)
+	if ext == "" {
+		ext = ".pem"
+	}
+	return filepath.Join(filepath.Dir(fullchainPath), "privkey"+ext) + suffix
+}
+
+// outputPaths returns the set of paths discoverFiles must never re-ingest:
+// out and truststoreout themselves, their ".tmp" atomic-write siblings, and
+// (for --format=pem-bundle, which writes a "privkey<ext>" alongside its
+// fullchain output) the matching privkeyPath for each. Paths are resolved
+// to absolute so they compare correctly against the walk's output.
+func outputPaths(out, truststoreout string) map[string]bool {
+	paths := make(map[string]bool)
+	add := func(path string) {
+		if path == "" {
+			return
+		}
+		if abspath, err := filepath.Abs(path); err == nil {
+			path = abspath
+		}
+		paths[path] = true
+	}
+	for _, path := range []string{out, truststoreout} {
+		if path == "" {
+			continue
+		}
+		add(path)
+		add(path + ".tmp")
+		add(privkeyPath(path))
+		add(privkeyPath(path + ".tmp"))
+	}
+	return paths
+}
+
+// watchedExt reports whether path is one of the file types watch mode
+// rebuilds on; PKCS#12/PFX/PKCS#7 bundles are intentionally excluded since
+// they're typically static inputs, not rotated secrets.
+func watchedExt(path string) bool {
+	switch filepath.Ext(path) {
+	case ".crt", ".key", ".pem":
+		return true
+	default:
+		return false
+	}
+}
+
+func main() {
+	var outfile, storepass, keypassword, format, truststoreout, logformat, loglevel, execCmd string
+	var certdirs, certfiles, inpasswords []string
+	var recurse, strict, watch bool
+	var watchDebounce time.Duration
+
+	flag.StringSliceVarP(&certdirs, "dir", "d", []string{os.Getenv("KSBUILDER_DIR")}, "directory to add files from")
+	flag.StringSliceVarP(&certfiles, "file", "f", make([]string, 0), "certificate or key file to add")
+	flag.StringVarP(&outfile, "out", "o", os.Getenv("KSBUILDER_OUT"), "path to output file")
+	flag.StringVarP(&storepass, "password", "p", os.Getenv("KSBUILDER_PASSWORD"), "keystore password for output file")
+	flag.StringVar(&keypassword, "key-password", os.Getenv("KSBUILDER_KEY_PASSWORD"), "password for encrypted private keys; prompted interactively if unset")
+	flag.StringArrayVarP(&inpasswords, "in-password", "P", nil, "password for a PKCS#12/PFX input file, matching --file/--dir discovery order; or 'path:password' to target one file")
+	flag.BoolVarP(&recurse, "recursive", "r", false, "recurse directories")
+	flag.BoolVar(&strict, "strict", false, "fail if an intermediate certificate doesn't chain up to the end-entity cert")
+	flag.StringVar(&format, "format", "pkcs12", "output keystore format: pkcs12, jks, or pem-bundle")
+	flag.StringVar(&truststoreout, "truststore-out", "", "path to write CA root certificates to as a separate trust store, instead of bundling them into --out")
+	flag.StringVar(&logformat, "log-format", "text", "log output format: text or json")
+	flag.StringVar(&loglevel, "log-level", "info", "log level: debug, info, warn, or error")
+	flag.BoolVar(&watch, "watch", false, "after the initial build, watch --dir inputs and rebuild the keystore on changes")
+	flag.DurationVar(&watchDebounce, "watch-debounce", 2*time.Second, "quiet period to wait for more filesystem events before rebuilding")
+	flag.StringVar(&execCmd, "exec", "", "command to run (via $SHELL -c) after each successful rebuild in --watch mode")
+
+	flag.Parse()
+
+	logger, err := newLogger(logformat, loglevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	if outfile == "" {
+		logger.Error("no output file specified; use --out or set KSBUILDER_OUT")
+		os.Exit(1)
+	}
+
+	if storepass == "" {
+		logger.Warn("password was not set, using library default", "default", pkcs12.DefaultPassword)
+		storepass = pkcs12.DefaultPassword
+	}
+
+	ks, err := ksbuilder.KeystoreFor(format)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Split --in-password values into path-targeted overrides ("path:password")
+	// and a positional queue consumed in the order PKCS#12/PFX files are found.
+	inPasswordsByPath := make(map[string]string)
+	var inPasswordQueue []string
+	for _, ip := range inpasswords {
+		if path, pw, ok := strings.Cut(ip, ":"); ok {
+			inPasswordsByPath[path] = pw
+		} else {
+			inPasswordQueue = append(inPasswordQueue, ip)
+		}
+	}
+	// resolvedInPasswords caches each path's positional password once it's
+	// popped off inPasswordQueue, so a later --watch rebuild re-adding the
+	// same file gets it back instead of draining an already-empty queue.
+	resolvedInPasswords := make(map[string]string)
+	resolveInPassword := func(path string) string {
+		if pw, ok := inPasswordsByPath[path]; ok {
+			return pw
+		}
+		if pw, ok := resolvedInPasswords[path]; ok {
+			return pw
+		}
+		if len(inPasswordQueue) > 0 {
+			pw := inPasswordQueue[0]
+			inPasswordQueue = inPasswordQueue[1:]
+			resolvedInPasswords[path] = pw
+			return pw
+		}
+		return ""
+	}
+
+	// build does one full discover->add->write pass with a fresh Builder, so
+	// it can be called again from watch mode without stale state leaking
+	// from the previous run.
+	build := func(atomic bool) error {
+		b := ksbuilder.New()
+		b.SetLogger(logger)
+		b.KeyPassword = keypassword
+		b.PasswordPrompt = promptKeyPassword
+		b.InPassword = resolveInPassword
+
+		discovered, err := discoverFiles(certdirs, recurse, outputPaths(outfile, truststoreout), logger)
+		if err != nil {
+			return err
+		}
+
+		for _, path := range append(append([]string{}, certfiles...), discovered...) {
+			if err := b.Add(path); err != nil {
+				return fmt.Errorf("failed to add %s: %w", path, err)
+			}
+		}
+		// Persist whatever password was resolved (flag, env, or interactive
+		// prompt) so a later call, e.g. a --watch rebuild, reuses it instead
+		// of prompting again or failing on a non-TTY stdin.
+		keypassword = b.KeyPassword
+
+		out, trust := outfile, truststoreout
+		// pem-bundle writes a "privkey<ext>" sidecar alongside out when there
+		// is a private key; it needs the same .tmp-then-rename treatment as
+		// out/trust so a crash or error mid-write can't leave a stale or
+		// orphaned privkey file. A trust-store-only build writes no sidecar.
+		privkey, outPrivkey := "", ""
+		if format == "pem-bundle" {
+			outPrivkey = privkeyPath(outfile)
+			privkey = outPrivkey
+		}
+		if atomic {
+			out += ".tmp"
+			if trust != "" {
+				trust += ".tmp"
+			}
+			if privkey != "" {
+				privkey += ".tmp"
+			}
+		}
+
+		logger.Info("writing output file", "path", out)
+		if err := b.WriteFormat(ks, out, trust, storepass, strict, 0644); err != nil {
+			if atomic {
+				os.Remove(out)
+				if trust != "" {
+					os.Remove(trust)
+				}
+				if privkey != "" {
+					os.Remove(privkey)
+				}
+			}
+			return err
+		}
+
+		if atomic {
+			if err := os.Rename(out, outfile); err != nil {
+				return err
+			}
+			if trust != "" {
+				if err := os.Rename(trust, truststoreout); err != nil {
+					return err
+				}
+			}
+			if privkey != "" {
+				if err := os.Rename(privkey, outPrivkey); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	if err := build(false); err != nil {
+		logger.Error("failed to build keystore", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("successfully built keystore", "path", outfile)
+
+	if !watch {
+		return
+	}
+
+	if err := runWatch(certdirs, recurse, watchDebounce, execCmd, logger, build); err != nil {
+		logger.Error("watch mode failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// runWatch observes certdirs for changes to cert/key files and rebuilds the
+// keystore, debouncing bursts of filesystem events (e.g. an editor's
+// write-then-rename) into a single rebuild.
+func runWatch(certdirs []string, recurse bool, debounce time.Duration, execCmd string, logger *slog.Logger, build func(atomic bool) error) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start filesystem watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	dirs, err := watchDirs(certdirs, recurse)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+		logger.Info("watching directory for changes", "dir", dir)
+	}
+
+	var timer *time.Timer
+	var rebuilding sync.Mutex
+	rebuild := func() {
+		// rebuild runs on the debounce timer's own goroutine, so a rebuild
+		// still in flight when the timer fires again must not overlap with
+		// the next one: both would race on the same atomic .tmp output path.
+		rebuilding.Lock()
+		defer rebuilding.Unlock()
+
+		logger.Info("rebuilding keystore after filesystem changes")
+		if err := build(true); err != nil {
+			logger.Error("failed to rebuild keystore", "error", err)
+			return
+		}
+		logger.Info("rebuilt keystore")
+		if execCmd != "" {
+			if err := runExecHook(execCmd); err != nil {
+				logger.Error("--exec hook failed", "error", err)
+			}
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !watchedExt(event.Name) {
+				continue
+			}
+			logger.Debug("filesystem event", "path", event.Name, "op", event.Op.String())
+			if timer == nil {
+				timer = time.AfterFunc(debounce, rebuild)
+			} else {
+				timer.Reset(debounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Error("filesystem watcher error", "error", err)
+		}
+	}
+}
+
+// watchDirs resolves certdirs (and, if recurse is set, their
+// subdirectories) to an absolute path list suitable for fsnotify.Add.
+func watchDirs(certdirs []string, recurse bool) ([]string, error) {
+	var dirs []string
+	for _, dir := range certdirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, abs)
+		if !recurse {
+			continue
+		}
+		err = filepath.Walk(abs, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && path != abs {
+				dirs = append(dirs, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dirs, nil
+}
+
+func runExecHook(cmdline string) error {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	cmd := exec.Command(shell, "-c", cmdline)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestOutputPathsIncludesTmpAndPrivkeySidecars(t *testing.T) {
+	out := filepath.Join("/certs", "fullchain.pem")
+	trust := filepath.Join("/certs", "truststore.pem")
+
+	paths := outputPaths(out, trust)
+
+	for _, want := range []string{
+		out,
+		out + ".tmp",
+		trust,
+		trust + ".tmp",
+		filepath.Join("/certs", "privkey.pem"),
+		filepath.Join("/certs", "privkey.pem.tmp"),
+	} {
+		if !paths[want] {
+			t.Errorf("expected outputPaths to include %q, got %v", want, paths)
+		}
+	}
+}
+
+func TestDiscoverFilesExcludesConfiguredOutputs(t *testing.T) {
+	dir := t.TempDir()
+
+	wantedCert := filepath.Join(dir, "leaf.pem")
+	out := filepath.Join(dir, "out.p12")
+	for _, path := range []string{wantedCert, out} {
+		if err := os.WriteFile(path, []byte("placeholder"), 0600); err != nil {
+			t.Fatalf("failed to write fixture %s: %v", path, err)
+		}
+	}
+
+	discovered, err := discoverFiles([]string{dir}, false, outputPaths(out, ""), testLogger())
+	if err != nil {
+		t.Fatalf("discoverFiles returned error: %v", err)
+	}
+
+	for _, path := range discovered {
+		if path == out {
+			t.Fatalf("expected --out path to be excluded from discovery, got %v", discovered)
+		}
+	}
+	found := false
+	for _, path := range discovered {
+		if path == wantedCert {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected the non-output cert file to be discovered, got %v", discovered)
+	}
+}
+
+func TestRunWatchSerializesOverlappingRebuilds(t *testing.T) {
+	dir := t.TempDir()
+	watched := filepath.Join(dir, "leaf.pem")
+	if err := os.WriteFile(watched, []byte("v1"), 0600); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	var inFlight int32
+	var overlapped int32
+	var calls int32
+	build := func(atomic_ bool) error {
+		if atomic.AddInt32(&inFlight, 1) > 1 {
+			atomic.StoreInt32(&overlapped, 1)
+		}
+		time.Sleep(30 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runWatch([]string{dir}, false, 10*time.Millisecond, "", testLogger(), build)
+	}()
+
+	// Give the watcher time to start, then fire two rapid writes close
+	// enough together that, without the overlap guard, their debounce
+	// timers could fire a rebuild while the previous one is still writing.
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(watched, []byte("v2"), 0600); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := os.WriteFile(watched, []byte("v3"), 0600); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	deadline := time.After(2 * time.Second)
+	for atomic.LoadInt32(&calls) < 2 {
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for rebuilds, got %d", atomic.LoadInt32(&calls))
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if atomic.LoadInt32(&overlapped) != 0 {
+		t.Fatal("expected rebuilds to be serialized, but two ran concurrently")
+	}
+}
@@ -0,0 +1,344 @@
+// Package ksbuilder assembles PKCS#12/JKS keystores and PEM bundles
+// from certificates and private keys gathered from PEM files, PKCS#12/PFX
+// bundles, and PKCS#7 bundles. It is the library underneath the ksbuilder
+// CLI, and is meant to also be embeddable in automation such as a
+// Kubernetes controller or CI pipeline.
+package ksbuilder
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"go.mozilla.org/pkcs7"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Builder accumulates certificates and at most one private key, then
+// encodes them into a keystore file via Write or WriteFormat.
+type Builder struct {
+	cacerts           []*x509.Certificate
+	intermediatecerts []*x509.Certificate
+	privkey           crypto.PrivateKey
+	entitycert        *x509.Certificate
+
+	logger *slog.Logger
+
+	// KeyPassword decrypts encrypted PEM/PKCS#8 private keys added via Add
+	// or AddPEM. If empty and an encrypted key is encountered, PasswordPrompt
+	// is consulted instead.
+	KeyPassword string
+	// PasswordPrompt is called lazily to obtain a key password when
+	// KeyPassword is unset and an encrypted private key is found. The result
+	// is cached in KeyPassword, so after a non-empty answer it is not called
+	// again; an empty answer leaves KeyPassword unset. Leave nil to disable
+	// prompting and fail instead.
+	PasswordPrompt func() (string, error)
+	// InPassword resolves the decryption password for the PKCS#12/PFX input
+	// file at path. Leave nil to use an empty password for all such files.
+	InPassword func(path string) string
+}
+
+// New returns a Builder ready to accumulate certificates and keys.
+func New() *Builder {
+	return &Builder{logger: slog.Default()}
+}
+
+// SetLogger overrides the logger used for informational and warning
+// messages emitted while adding files and building the output chain.
+func (b *Builder) SetLogger(logger *slog.Logger) {
+	b.logger = logger
+}
+
+func (b *Builder) log() *slog.Logger {
+	if b.logger == nil {
+		return slog.Default()
+	}
+	return b.logger
+}
+
+func (b *Builder) resolveKeyPassword() (string, error) {
+	if b.KeyPassword != "" {
+		return b.KeyPassword, nil
+	}
+	if b.PasswordPrompt == nil {
+		return "", errors.New("private key is encrypted but no KeyPassword was set and no PasswordPrompt is configured")
+	}
+	pw, err := b.PasswordPrompt()
+	if err != nil {
+		return "", err
+	}
+	b.KeyPassword = pw
+	return pw, nil
+}
+
+func (b *Builder) resolveInPassword(path string) string {
+	if b.InPassword == nil {
+		return ""
+	}
+	return b.InPassword(path)
+}
+
+func (b *Builder) addCertificate(cert *x509.Certificate) error {
+	if cert == nil {
+		return nil
+	}
+	if cert.IsCA {
+		if cert.Issuer.String() == cert.Subject.String() {
+			b.log().Debug("adding CA certificate", "subject", cert.Subject)
+			b.cacerts = append(b.cacerts, cert)
+		} else {
+			b.log().Debug("adding intermediate certificate", "subject", cert.Subject)
+			b.intermediatecerts = append(b.intermediatecerts, cert)
+		}
+		return nil
+	}
+	if b.entitycert != nil {
+		return errors.New("cannot have two end-entity certs in keystore. The only one should be for the keystore's private key")
+	}
+	b.log().Debug("adding end-entity certificate", "subject", cert.Subject)
+	b.entitycert = cert
+	return nil
+}
+
+func (b *Builder) addKey(key crypto.PrivateKey) error {
+	if key == nil {
+		return nil
+	}
+	if b.privkey != nil {
+		return errors.New("cannot have two private keys in keystore")
+	}
+	b.log().Debug("adding private key", "type", fmt.Sprintf("%T", key))
+	b.privkey = key
+	return nil
+}
+
+// Add reads path and adds any certificates and/or private key found in it,
+// auto-detecting PEM, PKCS#12/PFX, and PKCS#7 by file extension.
+func (b *Builder) Add(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	switch filepath.Ext(path) {
+	case ".p12", ".pfx":
+		return b.addPKCS12(path, data)
+	case ".p7b":
+		return b.addPKCS7(path, data)
+	default:
+		return b.addPEM(path, data)
+	}
+}
+
+// AddPEM adds any certificates and/or private key found in PEM-encoded data.
+func (b *Builder) AddPEM(data []byte) error {
+	return b.addPEM("", data)
+}
+
+func (b *Builder) addPKCS12(path string, data []byte) error {
+	privkey, cert, caCerts, err := pkcs12.DecodeChain(data, b.resolveInPassword(path))
+	if err != nil {
+		return fmt.Errorf("failed to decode PKCS#12 bundle %s: %w", path, err)
+	}
+	if privkey != nil {
+		switch privkey.(type) {
+		case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+			if err := b.addKey(privkey); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("failed to add private key from %s: unsupported key type %T", path, privkey)
+		}
+	}
+	if err := b.addCertificate(cert); err != nil {
+		return err
+	}
+	for _, ca := range caCerts {
+		if err := b.addCertificate(ca); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addPKCS7 decodes a PKCS#7 bundle and adds its certificates. .p7b files
+// are commonly PEM-armored (e.g. openssl's "crl2pkcs7" output, or a CA's
+// "certificate chain reply" download), so PEM blocks are unwrapped first;
+// anything else is assumed to already be raw DER.
+func (b *Builder) addPKCS7(path string, data []byte) error {
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		der = block.Bytes
+	}
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		return fmt.Errorf("failed to decode PKCS#7 bundle %s: %w", path, err)
+	}
+	for _, cert := range p7.Certificates {
+		if err := b.addCertificate(cert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Builder) addPEM(path string, data []byte) error {
+	var block *pem.Block
+	var certsBytes []byte
+	for {
+		block, data = pem.Decode(data)
+		if block == nil { // No more PEM blocks found.
+			break
+		}
+		switch block.Type {
+		case "PRIVATE KEY":
+			parseResult, _ := x509.ParsePKCS8PrivateKey(block.Bytes)
+			switch parseResult.(type) {
+			case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+				if err := b.addKey(parseResult); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("failed to parse private key from %s", path)
+			}
+		case "ENCRYPTED PRIVATE KEY":
+			pw, err := b.resolveKeyPassword()
+			if err != nil {
+				return err
+			}
+			keyBytes, err := decryptPKCS8PrivateKey(block.Bytes, []byte(pw))
+			if err != nil {
+				return fmt.Errorf("failed to decrypt private key in %s: %w", path, err)
+			}
+			parseResult, _ := x509.ParsePKCS8PrivateKey(keyBytes)
+			switch parseResult.(type) {
+			case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+				if err := b.addKey(parseResult); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("failed to parse private key from %s", path)
+			}
+		case "EC PRIVATE KEY":
+			eckey, err := x509.ParseECPrivateKey(block.Bytes)
+			if err != nil {
+				return fmt.Errorf("failed to parse EC private key from %s: %w", path, err)
+			}
+			if err := b.addKey(eckey); err != nil {
+				return err
+			}
+		case "RSA PRIVATE KEY":
+			keyBytes := block.Bytes
+			if x509.IsEncryptedPEMBlock(block) { //nolint:staticcheck // legacy PEM encryption has no replacement for PKCS#1 keys
+				pw, err := b.resolveKeyPassword()
+				if err != nil {
+					return err
+				}
+				keyBytes, err = x509.DecryptPEMBlock(block, []byte(pw)) //nolint:staticcheck // see above
+				if err != nil {
+					return fmt.Errorf("failed to decrypt private key in %s: %w", path, err)
+				}
+			}
+			privkey, err := x509.ParsePKCS1PrivateKey(keyBytes)
+			if err != nil {
+				return err
+			}
+			if err := b.addKey(privkey); err != nil {
+				return err
+			}
+		case "CERTIFICATE":
+			certsBytes = append(certsBytes, block.Bytes...)
+		}
+	}
+
+	certs, err := x509.ParseCertificates(certsBytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate in %s: %w", path, err)
+	}
+	for _, cert := range certs {
+		if err := b.addCertificate(cert); err != nil {
+			return fmt.Errorf("failed to add a certificate in %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// Write encodes the accumulated key and certificates as a PKCS#12 keystore
+// at path, protected by storepass. For other output formats or to split CA
+// roots into a separate trust store, use WriteFormat.
+func (b *Builder) Write(path, storepass string) error {
+	return b.WriteFormat(pkcs12Keystore{}, path, "", storepass, false, 0644)
+}
+
+// WriteFormat validates the accumulated key/certs and encodes them via ks.
+// When truststorePath is non-empty, the CA roots are split off into their
+// own trust store file instead of being bundled into the identity keystore.
+func (b *Builder) WriteFormat(ks Keystore, path, truststorePath, storepass string, strict bool, perm fs.FileMode) error {
+	if b.privkey != nil {
+		if b.entitycert == nil {
+			return errors.New("failed to generate keystore because privkey was set but found no matching end-entity certificate")
+		}
+
+		signer, ok := b.privkey.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("private key of type %T does not implement crypto.Signer", b.privkey)
+		}
+		equaler, ok := b.entitycert.PublicKey.(interface{ Equal(x crypto.PublicKey) bool })
+		if !ok {
+			return fmt.Errorf("end-entity certificate's public key of type %T cannot be compared", b.entitycert.PublicKey)
+		}
+		if !equaler.Equal(signer.Public()) {
+			return errors.New("private key does not match the end-entity certificate's public key")
+		}
+
+		// When the roots are going to a separate truststore, leave them out
+		// of the identity chain; otherwise bundle them in as before.
+		roots := b.cacerts
+		if truststorePath != "" {
+			roots = nil
+		}
+
+		// Build the ordered leaf->root chain for the entity cert, dropping
+		// any intermediates that don't actually belong to it.
+		chain, orphans, err := buildChain(b.entitycert, b.intermediatecerts, roots)
+		if err != nil {
+			return err
+		}
+		for _, orphan := range orphans {
+			if strict {
+				return fmt.Errorf("orphan certificate %s is not part of the chain for %s (--strict)", orphan.Subject, b.entitycert.Subject)
+			}
+			b.log().Warn("certificate is not part of the chain, omitting", "certificate", orphan.Subject, "chain_for", b.entitycert.Subject)
+		}
+
+		if err := ks.WriteIdentity(b.privkey, b.entitycert, chain, path, storepass, perm); err != nil {
+			return err
+		}
+	} else {
+		if err := ks.WriteTrustStore(append(b.cacerts, b.intermediatecerts...), path, storepass, perm); err != nil {
+			return err
+		}
+	}
+
+	if truststorePath != "" {
+		if len(b.cacerts) == 0 {
+			b.log().Warn("truststore output path given but no CA certificates were found to include", "path", truststorePath)
+		}
+		if err := ks.WriteTrustStore(b.cacerts, truststorePath, storepass, perm); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
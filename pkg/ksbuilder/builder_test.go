@@ -0,0 +1,109 @@
+package ksbuilder
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// generateTestCert creates a self-signed ECDSA certificate for test fixtures.
+func generateTestCert(t *testing.T, cn string, isCA bool) (*ecdsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: isCA,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create test certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse test certificate: %v", err)
+	}
+	return key, cert
+}
+
+func TestBuilderAddPKCS12(t *testing.T) {
+	key, cert := generateTestCert(t, "pkcs12-leaf", false)
+	payload, err := pkcs12.Encode(rand.Reader, key, cert, nil, "storepass")
+	if err != nil {
+		t.Fatalf("failed to encode test PKCS#12 bundle: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "bundle.p12")
+	if err := os.WriteFile(path, payload, 0600); err != nil {
+		t.Fatalf("failed to write test PKCS#12 bundle: %v", err)
+	}
+
+	b := New()
+	b.InPassword = func(string) string { return "storepass" }
+	if err := b.Add(path); err != nil {
+		t.Fatalf("Add returned error for PKCS#12 bundle: %v", err)
+	}
+	if b.entitycert == nil || b.entitycert.Subject.CommonName != "pkcs12-leaf" {
+		t.Fatalf("expected the end-entity cert to be recovered from the PKCS#12 bundle, got %v", b.entitycert)
+	}
+	if b.privkey == nil {
+		t.Fatal("expected a private key to be recovered from the PKCS#12 bundle")
+	}
+}
+
+func TestBuilderAddPKCS7DER(t *testing.T) {
+	_, cert := generateTestCert(t, "pkcs7-der", true)
+	der, err := pkcs7.DegenerateCertificate(cert.Raw)
+	if err != nil {
+		t.Fatalf("failed to build test PKCS#7 bundle: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "bundle.p7b")
+	if err := os.WriteFile(path, der, 0600); err != nil {
+		t.Fatalf("failed to write test PKCS#7 bundle: %v", err)
+	}
+
+	b := New()
+	if err := b.Add(path); err != nil {
+		t.Fatalf("Add returned error for a DER PKCS#7 bundle: %v", err)
+	}
+	if len(b.cacerts) != 1 || b.cacerts[0].Subject.CommonName != "pkcs7-der" {
+		t.Fatalf("expected the PKCS#7 bundle's certificate to be added, got %v", b.cacerts)
+	}
+}
+
+func TestBuilderAddPKCS7PEMArmored(t *testing.T) {
+	_, cert := generateTestCert(t, "pkcs7-pem", true)
+	der, err := pkcs7.DegenerateCertificate(cert.Raw)
+	if err != nil {
+		t.Fatalf("failed to build test PKCS#7 bundle: %v", err)
+	}
+	pemBundle := pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: der})
+	path := filepath.Join(t.TempDir(), "bundle.p7b")
+	if err := os.WriteFile(path, pemBundle, 0600); err != nil {
+		t.Fatalf("failed to write test PEM-armored PKCS#7 bundle: %v", err)
+	}
+
+	b := New()
+	if err := b.Add(path); err != nil {
+		t.Fatalf("Add returned error for a PEM-armored PKCS#7 bundle: %v", err)
+	}
+	if len(b.cacerts) != 1 || b.cacerts[0].Subject.CommonName != "pkcs7-pem" {
+		t.Fatalf("expected the PEM-armored PKCS#7 bundle's certificate to be added, got %v", b.cacerts)
+	}
+}
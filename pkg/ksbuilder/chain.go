@@ -0,0 +1,57 @@
+package ksbuilder
+
+import (
+	"bytes"
+	"crypto/x509"
+)
+
+// buildChain walks intermediates/roots from the entity cert up to a
+// self-signed root, matching issuers by AuthorityKeyId/SubjectKeyId when
+// present and falling back to Issuer/Subject name comparison otherwise. It
+// returns the chain in leaf->root order (excluding the entity cert itself,
+// which callers already track separately) along with any intermediates
+// that weren't part of the chain. Roots are only used as chain terminators,
+// never reported as orphans: an unrelated, legitimately trusted root that
+// doesn't chain to this entity isn't "dangling", it's just another root the
+// caller wants bundled into the output.
+func buildChain(entity *x509.Certificate, intermediates, roots []*x509.Certificate) (chain []*x509.Certificate, orphans []*x509.Certificate, err error) {
+	pool := append(append([]*x509.Certificate{}, intermediates...), roots...)
+	used := make([]bool, len(pool))
+
+	current := entity
+	for current.Issuer.String() != current.Subject.String() {
+		idx := findIssuer(current, pool, used)
+		if idx == -1 {
+			break
+		}
+		used[idx] = true
+		chain = append(chain, pool[idx])
+		current = pool[idx]
+	}
+
+	for i, cert := range pool[:len(intermediates)] {
+		if !used[i] {
+			orphans = append(orphans, cert)
+		}
+	}
+
+	return chain, orphans, nil
+}
+
+func findIssuer(cert *x509.Certificate, pool []*x509.Certificate, used []bool) int {
+	for i, candidate := range pool {
+		if used[i] {
+			continue
+		}
+		if len(cert.AuthorityKeyId) > 0 && len(candidate.SubjectKeyId) > 0 {
+			if bytes.Equal(cert.AuthorityKeyId, candidate.SubjectKeyId) {
+				return i
+			}
+			continue
+		}
+		if cert.Issuer.String() == candidate.Subject.String() {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,113 @@
+package ksbuilder
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func testCert(cn string, aki, ski []byte, selfSigned bool) *x509.Certificate {
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: cn},
+		SubjectKeyId:   ski,
+		AuthorityKeyId: aki,
+		IsCA:           true,
+	}
+	if selfSigned {
+		cert.Issuer = cert.Subject
+	} else {
+		cert.Issuer = pkix.Name{CommonName: cn + "-issuer"}
+	}
+	return cert
+}
+
+func TestBuildChainOrdersLeafToRoot(t *testing.T) {
+	root := testCert("root", nil, []byte("root-ski"), true)
+	intermediate := testCert("intermediate", []byte("root-ski"), []byte("intermediate-ski"), false)
+	intermediate.Issuer = root.Subject
+
+	entity := testCert("leaf", []byte("intermediate-ski"), []byte("leaf-ski"), false)
+	entity.Issuer = intermediate.Subject
+	entity.IsCA = false
+
+	chain, orphans, err := buildChain(entity, []*x509.Certificate{intermediate}, []*x509.Certificate{root})
+	if err != nil {
+		t.Fatalf("buildChain returned error: %v", err)
+	}
+	if len(orphans) != 0 {
+		t.Fatalf("expected no orphans, got %d", len(orphans))
+	}
+	if len(chain) != 2 {
+		t.Fatalf("expected a 2-certificate chain, got %d", len(chain))
+	}
+	if chain[0] != intermediate {
+		t.Errorf("expected intermediate first (leaf->root order), got %s", chain[0].Subject)
+	}
+	if chain[1] != root {
+		t.Errorf("expected root last (leaf->root order), got %s", chain[1].Subject)
+	}
+}
+
+func TestBuildChainFlagsOrphans(t *testing.T) {
+	root := testCert("root", nil, []byte("root-ski"), true)
+	intermediate := testCert("intermediate", []byte("root-ski"), []byte("intermediate-ski"), false)
+	intermediate.Issuer = root.Subject
+
+	entity := testCert("leaf", []byte("intermediate-ski"), []byte("leaf-ski"), false)
+	entity.Issuer = intermediate.Subject
+	entity.IsCA = false
+
+	unrelated := testCert("unrelated-ca", []byte("does-not-exist"), []byte("unrelated-ski"), false)
+	unrelated.Issuer = pkix.Name{CommonName: "some-other-root"}
+
+	chain, orphans, err := buildChain(entity, []*x509.Certificate{intermediate, unrelated}, []*x509.Certificate{root})
+	if err != nil {
+		t.Fatalf("buildChain returned error: %v", err)
+	}
+	if len(chain) != 2 {
+		t.Fatalf("expected a 2-certificate chain, got %d", len(chain))
+	}
+	if len(orphans) != 1 || orphans[0] != unrelated {
+		t.Fatalf("expected the unrelated cert to be flagged as an orphan, got %v", orphans)
+	}
+}
+
+func TestBuildChainDoesNotFlagUnrelatedRootsAsOrphans(t *testing.T) {
+	root := testCert("root", nil, []byte("root-ski"), true)
+	intermediate := testCert("intermediate", []byte("root-ski"), []byte("intermediate-ski"), false)
+	intermediate.Issuer = root.Subject
+
+	entity := testCert("leaf", []byte("intermediate-ski"), []byte("leaf-ski"), false)
+	entity.Issuer = intermediate.Subject
+	entity.IsCA = false
+
+	otherRoot := testCert("other-root", nil, []byte("other-root-ski"), true)
+
+	chain, orphans, err := buildChain(entity, []*x509.Certificate{intermediate}, []*x509.Certificate{root, otherRoot})
+	if err != nil {
+		t.Fatalf("buildChain returned error: %v", err)
+	}
+	if len(chain) != 2 {
+		t.Fatalf("expected a 2-certificate chain, got %d", len(chain))
+	}
+	if len(orphans) != 0 {
+		t.Fatalf("expected an unrelated trusted root not to be flagged as an orphan, got %v", orphans)
+	}
+}
+
+func TestBuildChainSelfSignedEntityHasNoChain(t *testing.T) {
+	entity := testCert("self-signed", nil, []byte("self-ski"), true)
+	entity.IsCA = false
+	entity.Issuer = entity.Subject
+
+	chain, orphans, err := buildChain(entity, nil, nil)
+	if err != nil {
+		t.Fatalf("buildChain returned error: %v", err)
+	}
+	if len(chain) != 0 {
+		t.Fatalf("expected an empty chain for a self-signed entity cert, got %d entries", len(chain))
+	}
+	if len(orphans) != 0 {
+		t.Fatalf("expected no orphans, got %d", len(orphans))
+	}
+}
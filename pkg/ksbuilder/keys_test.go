@@ -0,0 +1,129 @@
+package ksbuilder
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// generateTestEd25519Cert creates a self-signed Ed25519 certificate for test
+// fixtures, mirroring generateTestCert in builder_test.go.
+func generateTestEd25519Cert(t *testing.T, cn string) (ed25519.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test Ed25519 key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	if err != nil {
+		t.Fatalf("failed to create test certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse test certificate: %v", err)
+	}
+	return priv, cert
+}
+
+func writeTestPEM(t *testing.T, dir, name string, blocks ...*pem.Block) string {
+	t.Helper()
+	var buf []byte
+	for _, block := range blocks {
+		buf = append(buf, pem.EncodeToMemory(block)...)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf, 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestBuilderAddECDSAKeyRoundTripsThroughPKCS12(t *testing.T) {
+	key, cert := generateTestCert(t, "ecdsa-leaf", false)
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal EC private key: %v", err)
+	}
+	dir := t.TempDir()
+	path := writeTestPEM(t, dir, "leaf.pem",
+		&pem.Block{Type: "EC PRIVATE KEY", Bytes: der},
+		&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw},
+	)
+
+	b := New()
+	if err := b.Add(path); err != nil {
+		t.Fatalf("Add returned error for an EC key/cert PEM: %v", err)
+	}
+
+	out := filepath.Join(dir, "out.p12")
+	if err := b.Write(out, "storepass"); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	payload, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("failed to read output keystore: %v", err)
+	}
+	privkey, gotCert, _, err := pkcs12.DecodeChain(payload, "storepass")
+	if err != nil {
+		t.Fatalf("failed to decode output keystore: %v", err)
+	}
+	if _, ok := privkey.(*ecdsa.PrivateKey); !ok {
+		t.Fatalf("expected an *ecdsa.PrivateKey in the output keystore, got %T", privkey)
+	}
+	if gotCert.Subject.CommonName != "ecdsa-leaf" {
+		t.Fatalf("unexpected certificate in output keystore: %s", gotCert.Subject)
+	}
+}
+
+func TestBuilderAddEd25519KeyRoundTripsThroughPKCS12(t *testing.T) {
+	key, cert := generateTestEd25519Cert(t, "ed25519-leaf")
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal Ed25519 private key: %v", err)
+	}
+	dir := t.TempDir()
+	path := writeTestPEM(t, dir, "leaf.pem",
+		&pem.Block{Type: "PRIVATE KEY", Bytes: der},
+		&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw},
+	)
+
+	b := New()
+	if err := b.Add(path); err != nil {
+		t.Fatalf("Add returned error for an Ed25519 key/cert PEM: %v", err)
+	}
+
+	out := filepath.Join(dir, "out.p12")
+	if err := b.Write(out, "storepass"); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	payload, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("failed to read output keystore: %v", err)
+	}
+	privkey, gotCert, _, err := pkcs12.DecodeChain(payload, "storepass")
+	if err != nil {
+		t.Fatalf("failed to decode output keystore: %v", err)
+	}
+	if _, ok := privkey.(ed25519.PrivateKey); !ok {
+		t.Fatalf("expected an ed25519.PrivateKey in the output keystore, got %T", privkey)
+	}
+	if gotCert.Subject.CommonName != "ed25519-leaf" {
+		t.Fatalf("unexpected certificate in output keystore: %s", gotCert.Subject)
+	}
+}
@@ -0,0 +1,165 @@
+package ksbuilder
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	keystore "github.com/pavlo-v-chernykh/keystore-go/v4"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Keystore encodes an identity (private key + certificate chain) or a bare
+// trust store (CA certificates only) into a specific on-disk format. Each
+// --format value is backed by one implementation below.
+type Keystore interface {
+	WriteIdentity(privkey crypto.PrivateKey, entity *x509.Certificate, chain []*x509.Certificate, path, storepass string, perm fs.FileMode) error
+	WriteTrustStore(certs []*x509.Certificate, path, storepass string, perm fs.FileMode) error
+}
+
+// KeystoreFor resolves a --format flag value to a Keystore implementation.
+func KeystoreFor(format string) (Keystore, error) {
+	switch format {
+	case "", "pkcs12":
+		return pkcs12Keystore{}, nil
+	case "jks":
+		return jksKeystore{}, nil
+	case "pem-bundle":
+		return pemBundleKeystore{}, nil
+	default:
+		return nil, fmt.Errorf("unknown --format %q (expected pkcs12, jks, or pem-bundle)", format)
+	}
+}
+
+type pkcs12Keystore struct{}
+
+func (pkcs12Keystore) WriteIdentity(privkey crypto.PrivateKey, entity *x509.Certificate, chain []*x509.Certificate, path, storepass string, perm fs.FileMode) error {
+	payload, err := pkcs12.Encode(rand.Reader, privkey, entity, chain, storepass)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, payload, perm)
+}
+
+func (pkcs12Keystore) WriteTrustStore(certs []*x509.Certificate, path, storepass string, perm fs.FileMode) error {
+	payload, err := pkcs12.EncodeTrustStore(rand.Reader, certs, storepass)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, payload, perm)
+}
+
+type jksKeystore struct{}
+
+func (jksKeystore) WriteIdentity(privkey crypto.PrivateKey, entity *x509.Certificate, chain []*x509.Certificate, path, storepass string, perm fs.FileMode) error {
+	der, err := x509.MarshalPKCS8PrivateKey(privkey)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key for JKS output: %w", err)
+	}
+
+	certChain := make([]keystore.Certificate, 0, len(chain)+1)
+	certChain = append(certChain, keystore.Certificate{Type: "X509", Content: entity.Raw})
+	for _, cert := range chain {
+		certChain = append(certChain, keystore.Certificate{Type: "X509", Content: cert.Raw})
+	}
+
+	ks := keystore.New()
+	entry := keystore.PrivateKeyEntry{
+		CreationTime:     time.Now(),
+		PrivateKey:       der,
+		CertificateChain: certChain,
+	}
+	if err := ks.SetPrivateKeyEntry(jksAlias(entity), entry, []byte(storepass)); err != nil {
+		return err
+	}
+
+	return writeKeystore(ks, path, storepass, perm)
+}
+
+func (jksKeystore) WriteTrustStore(certs []*x509.Certificate, path, storepass string, perm fs.FileMode) error {
+	ks := keystore.New()
+	for i, cert := range certs {
+		entry := keystore.TrustedCertificateEntry{
+			CreationTime: time.Now(),
+			Certificate:  keystore.Certificate{Type: "X509", Content: cert.Raw},
+		}
+		if err := ks.SetTrustedCertificateEntry(fmt.Sprintf("ca-%d-%s", i, jksAlias(cert)), entry); err != nil {
+			return err
+		}
+	}
+	return writeKeystore(ks, path, storepass, perm)
+}
+
+func writeKeystore(ks keystore.KeyStore, path, storepass string, perm fs.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return ks.Store(f, []byte(storepass))
+}
+
+func jksAlias(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	return "identity"
+}
+
+// pemBundleKeystore writes a plain concatenated PEM file per the
+// certbot-style "fullchain.pem" + "privkey.pem" convention: the identity's
+// fullchain is written to the requested path, and the private key alongside
+// it in the same directory as "privkey<ext>" (see privkeyPath), e.g.
+// "privkey.pem" for "fullchain.pem".
+type pemBundleKeystore struct{}
+
+func (pemBundleKeystore) WriteIdentity(privkey crypto.PrivateKey, entity *x509.Certificate, chain []*x509.Certificate, path, storepass string, perm fs.FileMode) error {
+	var fullchain bytes.Buffer
+	fullchain.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: entity.Raw}))
+	for _, cert := range chain {
+		fullchain.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	}
+	if err := os.WriteFile(path, fullchain.Bytes(), perm); err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privkey)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key for PEM output: %w", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return os.WriteFile(privkeyPath(path), keyPEM, perm)
+}
+
+func (pemBundleKeystore) WriteTrustStore(certs []*x509.Certificate, path, storepass string, perm fs.FileMode) error {
+	var buf bytes.Buffer
+	for _, cert := range certs {
+		buf.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	}
+	return os.WriteFile(path, buf.Bytes(), perm)
+}
+
+// privkeyPath derives the "privkey<ext>" sidecar path for a fullchain
+// output path. A trailing ".tmp" (added by callers doing an atomic
+// write-then-rename) is stripped first, so the sidecar keeps the real
+// extension, e.g. "/certs/fullchain.pem.tmp" -> "/certs/privkey.pem.tmp".
+func privkeyPath(fullchainPath string) string {
+	suffix := ""
+	if stripped := strings.TrimSuffix(fullchainPath, ".tmp"); stripped != fullchainPath {
+		fullchainPath = stripped
+		suffix = ".tmp"
+	}
+	ext := filepath.Ext(fullchainPath)
+	if ext == "" {
+		ext = ".pem"
+	}
+	return filepath.Join(filepath.Dir(fullchainPath), "privkey"+ext) + suffix
+}
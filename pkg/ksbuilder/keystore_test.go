@@ -0,0 +1,117 @@
+package ksbuilder
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	keystore "github.com/pavlo-v-chernykh/keystore-go/v4"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestPKCS12KeystoreWriteIdentityRoundTrips(t *testing.T) {
+	key, entity := generateTestCert(t, "pkcs12-identity", false)
+	_, root := generateTestCert(t, "pkcs12-root", true)
+
+	path := filepath.Join(t.TempDir(), "out.p12")
+	if err := (pkcs12Keystore{}).WriteIdentity(key, entity, []*x509.Certificate{root}, path, "storepass", 0644); err != nil {
+		t.Fatalf("WriteIdentity returned error: %v", err)
+	}
+
+	payload, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read output keystore: %v", err)
+	}
+	privkey, gotEntity, caCerts, err := pkcs12.DecodeChain(payload, "storepass")
+	if err != nil {
+		t.Fatalf("failed to decode output keystore: %v", err)
+	}
+	if _, ok := privkey.(*ecdsa.PrivateKey); !ok {
+		t.Fatalf("expected an *ecdsa.PrivateKey in the output keystore, got %T", privkey)
+	}
+	if gotEntity.Subject.CommonName != "pkcs12-identity" {
+		t.Fatalf("unexpected end-entity certificate: %s", gotEntity.Subject)
+	}
+	if len(caCerts) != 1 || caCerts[0].Subject.CommonName != "pkcs12-root" {
+		t.Fatalf("expected the root to round-trip in the chain, got %v", caCerts)
+	}
+}
+
+func TestJKSKeystoreWriteIdentityRoundTrips(t *testing.T) {
+	key, entity := generateTestCert(t, "jks-identity", false)
+	_, root := generateTestCert(t, "jks-root", true)
+
+	path := filepath.Join(t.TempDir(), "out.jks")
+	if err := (jksKeystore{}).WriteIdentity(key, entity, []*x509.Certificate{root}, path, "storepass", 0644); err != nil {
+		t.Fatalf("WriteIdentity returned error: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open output keystore: %v", err)
+	}
+	defer f.Close()
+
+	ks := keystore.New()
+	if err := ks.Load(f, []byte("storepass")); err != nil {
+		t.Fatalf("failed to load output keystore: %v", err)
+	}
+	entry, err := ks.GetPrivateKeyEntry(jksAlias(entity), []byte("storepass"))
+	if err != nil {
+		t.Fatalf("failed to read back private key entry: %v", err)
+	}
+	if len(entry.CertificateChain) != 2 {
+		t.Fatalf("expected a 2-certificate chain (entity + root), got %d", len(entry.CertificateChain))
+	}
+}
+
+func TestPEMBundleKeystoreWriteIdentityRoundTrips(t *testing.T) {
+	key, entity := generateTestCert(t, "pem-identity", false)
+	_, root := generateTestCert(t, "pem-root", true)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fullchain.pem")
+	if err := (pemBundleKeystore{}).WriteIdentity(key, entity, []*x509.Certificate{root}, path, "storepass", 0644); err != nil {
+		t.Fatalf("WriteIdentity returned error: %v", err)
+	}
+
+	fullchain, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read fullchain.pem: %v", err)
+	}
+	certs, err := parseAllCertificates(fullchain)
+	if err != nil {
+		t.Fatalf("failed to parse fullchain.pem: %v", err)
+	}
+	if len(certs) != 2 {
+		t.Fatalf("expected 2 certificates in fullchain.pem, got %d", len(certs))
+	}
+
+	privkeyPEM, err := os.ReadFile(filepath.Join(dir, "privkey.pem"))
+	if err != nil {
+		t.Fatalf("failed to read privkey.pem: %v", err)
+	}
+	block, _ := pem.Decode(privkeyPEM)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		t.Fatalf("expected a PKCS#8 PRIVATE KEY block in privkey.pem, got %v", block)
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		t.Fatalf("privkey.pem did not parse as a PKCS#8 private key: %v", err)
+	}
+}
+
+func parseAllCertificates(pemData []byte) ([]*x509.Certificate, error) {
+	var der []byte
+	for {
+		var block *pem.Block
+		block, pemData = pem.Decode(pemData)
+		if block == nil {
+			break
+		}
+		der = append(der, block.Bytes...)
+	}
+	return x509.ParseCertificates(der)
+}
@@ -0,0 +1,97 @@
+package ksbuilder
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuilderWriteFormatRequiresEntityCertForPrivateKey(t *testing.T) {
+	key, _ := generateTestCert(t, "orphan-key", false)
+	b := New()
+	if err := b.addKey(key); err != nil {
+		t.Fatalf("addKey returned error: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "out.p12")
+	err := b.Write(path, "storepass")
+	if err == nil || !strings.Contains(err.Error(), "no matching end-entity certificate") {
+		t.Fatalf("expected a missing-end-entity-cert error, got %v", err)
+	}
+}
+
+func TestBuilderWriteFormatRejectsMismatchedKeyAndCert(t *testing.T) {
+	key, _ := generateTestCert(t, "key-owner", false)
+	_, otherCert := generateTestCert(t, "cert-owner", false)
+
+	b := New()
+	if err := b.addKey(key); err != nil {
+		t.Fatalf("addKey returned error: %v", err)
+	}
+	if err := b.addCertificate(otherCert); err != nil {
+		t.Fatalf("addCertificate returned error: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "out.p12")
+	err := b.Write(path, "storepass")
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected a key/cert mismatch error, got %v", err)
+	}
+}
+
+func TestBuilderWriteFormatSplitsTrustStore(t *testing.T) {
+	key, entity := generateTestCert(t, "split-identity", false)
+	_, root := generateTestCert(t, "split-root", true)
+
+	b := New()
+	if err := b.addKey(key); err != nil {
+		t.Fatalf("addKey returned error: %v", err)
+	}
+	if err := b.addCertificate(entity); err != nil {
+		t.Fatalf("addCertificate returned error: %v", err)
+	}
+	if err := b.addCertificate(root); err != nil {
+		t.Fatalf("addCertificate returned error: %v", err)
+	}
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.p12")
+	trust := filepath.Join(dir, "trust.p12")
+	if err := b.WriteFormat(pkcs12Keystore{}, out, trust, "storepass", false, 0644); err != nil {
+		t.Fatalf("WriteFormat returned error: %v", err)
+	}
+
+	if _, err := os.Stat(trust); err != nil {
+		t.Fatalf("expected a separate truststore file to be written: %v", err)
+	}
+}
+
+func TestBuilderSetLoggerIsUsedForWarnings(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	key, entity := generateTestCert(t, "logger-identity", false)
+	_, unrelated := generateTestCert(t, "logger-unrelated-intermediate", true)
+
+	b := New()
+	b.SetLogger(logger)
+	if err := b.addKey(key); err != nil {
+		t.Fatalf("addKey returned error: %v", err)
+	}
+	if err := b.addCertificate(entity); err != nil {
+		t.Fatalf("addCertificate returned error: %v", err)
+	}
+	b.intermediatecerts = append(b.intermediatecerts, unrelated)
+
+	path := filepath.Join(t.TempDir(), "out.p12")
+	if err := b.Write(path, "storepass"); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "not part of the chain") {
+		t.Fatalf("expected the orphan-certificate warning on the logger set via SetLogger, got %q", buf.String())
+	}
+}
@@ -0,0 +1,172 @@
+package ksbuilder
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// ASN.1 object identifiers used by PKCS#8 encrypted private keys (RFC 5958/8018).
+var (
+	oidPBES2      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm algorithmIdentifier
+	EncryptedData       []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc algorithmIdentifier
+	EncryptionScheme  algorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                 `asn1:"optional"`
+	PRF            algorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8PrivateKey unwraps a DER-encoded EncryptedPrivateKeyInfo
+// structure (as found in "ENCRYPTED PRIVATE KEY" PEM blocks) and returns the
+// decrypted PKCS#8 DER bytes, suitable for x509.ParsePKCS8PrivateKey. Only
+// PBES2 with a PBKDF2 KDF is supported, which covers the keys produced by
+// OpenSSL, step-cli, and most modern CAs.
+func decryptPKCS8PrivateKey(der []byte, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse EncryptedPrivateKeyInfo: %w", err)
+	}
+
+	if !info.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported PKCS#8 encryption algorithm %s (only PBES2 is supported)", info.EncryptionAlgorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("failed to parse PBES2 parameters: %w", err)
+	}
+
+	key, err := deriveKey(params.KeyDerivationFunc, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptCBC(params.EncryptionScheme, key, info.EncryptedData)
+}
+
+func deriveKey(kdf algorithmIdentifier, password []byte) ([]byte, error) {
+	if !kdf.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s (only PBKDF2 is supported)", kdf.Algorithm)
+	}
+
+	var params pbkdf2Params
+	if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("failed to parse PBKDF2 parameters: %w", err)
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(params.PRF.Algorithm) == 0 || params.PRF.Algorithm.Equal(oidHMACSHA1):
+		prf = sha1.New
+	case params.PRF.Algorithm.Equal(oidHMACSHA256):
+		prf = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 PRF %s", params.PRF.Algorithm)
+	}
+
+	keyLen := params.KeyLength
+	if keyLen == 0 {
+		keyLen = 32 // resolved against the cipher's actual key size in decryptCBC
+	}
+
+	return pbkdf2.Key(password, params.Salt, params.IterationCount, keyLen, prf), nil
+}
+
+func decryptCBC(scheme algorithmIdentifier, key, ciphertext []byte) ([]byte, error) {
+	var block cipher.Block
+	var err error
+	var ivLen int
+
+	switch {
+	case scheme.Algorithm.Equal(oidDESEDE3CBC):
+		block, err = des.NewTripleDESCipher(resizeKey(key, 24))
+		ivLen = des.BlockSize
+	case scheme.Algorithm.Equal(oidAES128CBC):
+		block, err = aes.NewCipher(resizeKey(key, 16))
+		ivLen = aes.BlockSize
+	case scheme.Algorithm.Equal(oidAES192CBC):
+		block, err = aes.NewCipher(resizeKey(key, 24))
+		ivLen = aes.BlockSize
+	case scheme.Algorithm.Equal(oidAES256CBC):
+		block, err = aes.NewCipher(resizeKey(key, 32))
+		ivLen = aes.BlockSize
+	default:
+		return nil, fmt.Errorf("unsupported PBES2 encryption scheme %s", scheme.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(scheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("failed to parse cipher IV: %w", err)
+	}
+	if len(iv) != ivLen {
+		return nil, fmt.Errorf("unexpected IV length %d for %s", len(iv), scheme.Algorithm)
+	}
+	if len(ciphertext)%block.BlockSize() != 0 {
+		return nil, errors.New("encrypted private key data is not a multiple of the cipher block size")
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	return unpadPKCS7(plaintext)
+}
+
+// resizeKey truncates an over-long derived key to the size the chosen cipher
+// actually needs (PBKDF2 parameters may omit keyLength, defaulting us to 32).
+func resizeKey(key []byte, size int) []byte {
+	if len(key) >= size {
+		return key[:size]
+	}
+	return key
+}
+
+func unpadPKCS7(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("cannot unpad empty data")
+	}
+	padLen := int(data[len(data)-1])
+	if padLen == 0 || padLen > len(data) {
+		return nil, errors.New("invalid PKCS#7 padding (likely wrong password)")
+	}
+	for _, b := range data[len(data)-padLen:] {
+		if int(b) != padLen {
+			return nil, errors.New("invalid PKCS#7 padding (likely wrong password)")
+		}
+	}
+	return data[:len(data)-padLen], nil
+}